@@ -0,0 +1,446 @@
+// Package internal implements a small HTTP client for the Dinahosting API,
+// including retry/backoff handling and a per-zone lock (see LockZone) that
+// callers hold for the duration of a batch of related calls so that
+// concurrent callers (e.g. parallel ACME challenges) don't race each other.
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultEndpointBase = "https://dinahosting.com/special/api.php"
+
+// Retry tuning for transient failures (5xx responses, network errors).
+const (
+	maxRetries     = 4
+	baseRetryDelay = 500 * time.Millisecond
+	maxRetryDelay  = 8 * time.Second
+)
+
+// Command identifies a Dinahosting API command.
+type Command string
+
+// API commands as per the spec.
+const (
+	CommandZoneGetAll          Command = "Domain_Zone_GetAll"
+	CommandZoneAddTypeA        Command = "Domain_Zone_AddTypeA"
+	CommandZoneDeleteTypeA     Command = "Domain_Zone_DeleteTypeA"
+	CommandZoneAddTypeAAAA     Command = "Domain_Zone_AddTypeAAAA"
+	CommandZoneDeleteTypeAAAA  Command = "Domain_Zone_DeleteTypeAAAA"
+	CommandZoneAddTypeTXT      Command = "Domain_Zone_AddTypeTXT"
+	CommandZoneDeleteTypeTXT   Command = "Domain_Zone_DeleteTypeTXT"
+	CommandZoneAddTypeCNAME    Command = "Domain_Zone_AddTypeCNAME"
+	CommandZoneDeleteTypeCNAME Command = "Domain_Zone_DeleteTypeCNAME"
+	CommandZoneAddTypeMX       Command = "Domain_Zone_AddTypeMX"
+	CommandZoneDeleteTypeMX    Command = "Domain_Zone_DeleteTypeMX"
+	CommandZoneAddTypeNS       Command = "Domain_Zone_AddTypeNS"
+	CommandZoneDeleteTypeNS    Command = "Domain_Zone_DeleteTypeNS"
+	CommandZoneAddTypeSRV      Command = "Domain_Zone_AddTypeSRV"
+	CommandZoneDeleteTypeSRV   Command = "Domain_Zone_DeleteTypeSRV"
+	CommandZoneAddTypeCAA      Command = "Domain_Zone_AddTypeCAA"
+	CommandZoneDeleteTypeCAA   Command = "Domain_Zone_DeleteTypeCAA"
+)
+
+// Record is a single DNS record as returned by Domain_Zone_GetAll.
+type Record struct {
+	Type                string
+	Hostname            string
+	DestinationHostname string
+	Ip                  string
+	Address             string
+	Text                string
+	Destination         string
+	Server              string
+	Priority            int
+	Weight              int
+	Port                int
+	Flags               int
+	Tag                 string
+	Value               string
+}
+
+// Response is the envelope returned by every Dinahosting API call.
+type Response struct {
+	TrID         string   `json:"trId,omitempty"`
+	ResponseCode int16    `json:"responseCode,omitempty"`
+	Message      string   `json:"message,omitempty"`
+	Records      []Record `json:"data,omitempty"`
+	Command      string   `json:"command,omitempty"`
+}
+
+// APIError is returned whenever Dinahosting answers a request with a
+// well-formed response whose Message is not "Success.". Callers can use
+// errors.As to inspect ResponseCode and decide whether the failure is
+// safe to ignore (e.g. "record already exists" in an AppendRecords call).
+type APIError struct {
+	ResponseCode int16
+	Message      string
+	Command      string
+	TrID         string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("dinahosting: %s: %s (code %d, trId %s)", e.Command, e.Message, e.ResponseCode, e.TrID)
+}
+
+// rawRecord mirrors the JSON shape of a record inside a Domain_Zone_GetAll response.
+type rawRecord struct {
+	RecordType          string `json:"type,omitempty"`
+	Hostname            string `json:"hostname,omitempty"`
+	DestinationHostname string `json:"destinationHostname,omitempty"`
+	Ip                  string `json:"ip,omitempty"`
+	Address             string `json:"address,omitempty"`
+	Text                string `json:"text,omitempty"`
+	Destination         string `json:"destination,omitempty"`
+	Server              string `json:"server,omitempty"`
+	Priority            int    `json:"priority,omitempty"`
+	Weight              int    `json:"weight,omitempty"`
+	Port                int    `json:"port,omitempty"`
+	Flags               int    `json:"flags,omitempty"`
+	Tag                 string `json:"tag,omitempty"`
+	Value               string `json:"value,omitempty"`
+}
+
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var raw rawRecord
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = Record{
+		Type:                raw.RecordType,
+		Hostname:            raw.Hostname,
+		DestinationHostname: raw.DestinationHostname,
+		Ip:                  raw.Ip,
+		Address:             raw.Address,
+		Text:                raw.Text,
+		Destination:         raw.Destination,
+		Server:              raw.Server,
+		Priority:            raw.Priority,
+		Weight:              raw.Weight,
+		Port:                raw.Port,
+		Flags:               raw.Flags,
+		Tag:                 raw.Tag,
+		Value:               raw.Value,
+	}
+	return nil
+}
+
+// Client is a small wrapper around the Dinahosting API.
+//
+// NewClient only fills in Username and Password; every other field of the
+// zero value falls back to a default on first use. Calls against
+// different zones are always safe to run concurrently. A Client does not
+// serialize calls against the same zone on its own: callers that perform a
+// batch of related calls against one zone (e.g. the read-decide-write cycle
+// behind a SetRecords) must hold LockZone for the whole batch. Provider does
+// this around every one of its public methods, so parallel ACME challenges
+// touching the same zone don't race each other.
+type Client struct {
+	Username string
+	Password string
+
+	// HTTPClient performs the actual requests. It can be overridden to
+	// plug in a custom transport, proxy, or test server. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// BaseURL overrides the Dinahosting API endpoint. Used by tests to
+	// point the client at an httptest.Server instead of the live API.
+	BaseURL string
+
+	zoneLocksMu sync.Mutex
+	zoneLocks   map[string]*sync.Mutex
+}
+
+// NewClient returns a Client for the given credentials.
+func NewClient(username, password string) *Client {
+	return &Client{
+		Username: username,
+		Password: password,
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) endpoint() string {
+	if c.BaseURL != "" {
+		return c.BaseURL
+	}
+	return defaultEndpointBase
+}
+
+// zoneLock returns the mutex guarding zone, creating it on first use.
+func (c *Client) zoneLock(zone string) *sync.Mutex {
+	c.zoneLocksMu.Lock()
+	defer c.zoneLocksMu.Unlock()
+
+	if c.zoneLocks == nil {
+		c.zoneLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := c.zoneLocks[zone]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.zoneLocks[zone] = lock
+	}
+	return lock
+}
+
+// LockZone acquires the mutex guarding zone and returns a function that
+// releases it. Hold it for the full duration of a batch of related calls
+// against zone (e.g. a read-decide-write cycle) so that a concurrent batch
+// against the same zone can't interleave with it. The mutex is not
+// re-entrant, so a goroutine must not call LockZone again for the same zone
+// before releasing it.
+func (c *Client) LockZone(zone string) func() {
+	lock := c.zoneLock(zone)
+	lock.Lock()
+	return lock.Unlock
+}
+
+// ZoneGetAll retrieves every record in zone.
+func (c *Client) ZoneGetAll(ctx context.Context, zone string) (*Response, error) {
+	return c.do(ctx, zone, c.buildQuery(zone, CommandZoneGetAll, nil))
+}
+
+// AddTypeA creates an A record.
+func (c *Client) AddTypeA(ctx context.Context, zone, hostname, ip string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeA, map[string]string{"hostname": hostname, "ip": ip})
+}
+
+// DeleteTypeA deletes an A record.
+func (c *Client) DeleteTypeA(ctx context.Context, zone, hostname, ip string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeA, map[string]string{"hostname": hostname, "ip": ip})
+}
+
+// AddTypeAAAA creates an AAAA record.
+func (c *Client) AddTypeAAAA(ctx context.Context, zone, hostname, ip string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeAAAA, map[string]string{"hostname": hostname, "ip": ip})
+}
+
+// DeleteTypeAAAA deletes an AAAA record.
+func (c *Client) DeleteTypeAAAA(ctx context.Context, zone, hostname, ip string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeAAAA, map[string]string{"hostname": hostname, "ip": ip})
+}
+
+// AddTypeTXT creates a TXT record.
+func (c *Client) AddTypeTXT(ctx context.Context, zone, hostname, text string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeTXT, map[string]string{"hostname": hostname, "text": text})
+}
+
+// DeleteTypeTXT deletes a TXT record.
+func (c *Client) DeleteTypeTXT(ctx context.Context, zone, hostname, value string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeTXT, map[string]string{"hostname": hostname, "value": value})
+}
+
+// AddTypeCNAME creates a CNAME record.
+func (c *Client) AddTypeCNAME(ctx context.Context, zone, hostname, destination string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeCNAME, map[string]string{"hostname": hostname, "destination": destination})
+}
+
+// DeleteTypeCNAME deletes a CNAME record.
+func (c *Client) DeleteTypeCNAME(ctx context.Context, zone, hostname, destination string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeCNAME, map[string]string{"hostname": hostname, "destination": destination})
+}
+
+// AddTypeMX creates an MX record.
+func (c *Client) AddTypeMX(ctx context.Context, zone, hostname, server string, priority int) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeMX, map[string]string{"hostname": hostname, "server": server, "priority": strconv.Itoa(priority)})
+}
+
+// DeleteTypeMX deletes an MX record.
+func (c *Client) DeleteTypeMX(ctx context.Context, zone, hostname, server string, priority int) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeMX, map[string]string{"hostname": hostname, "server": server, "priority": strconv.Itoa(priority)})
+}
+
+// AddTypeNS creates an NS record.
+func (c *Client) AddTypeNS(ctx context.Context, zone, hostname, destination string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeNS, map[string]string{"hostname": hostname, "destination": destination})
+}
+
+// DeleteTypeNS deletes an NS record.
+func (c *Client) DeleteTypeNS(ctx context.Context, zone, hostname, destination string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeNS, map[string]string{"hostname": hostname, "destination": destination})
+}
+
+// AddTypeSRV creates an SRV record.
+func (c *Client) AddTypeSRV(ctx context.Context, zone, hostname, server string, priority, weight, port int) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeSRV, map[string]string{
+		"hostname": hostname, "server": server,
+		"priority": strconv.Itoa(priority), "weight": strconv.Itoa(weight), "port": strconv.Itoa(port),
+	})
+}
+
+// DeleteTypeSRV deletes an SRV record.
+func (c *Client) DeleteTypeSRV(ctx context.Context, zone, hostname, server string, priority, weight, port int) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeSRV, map[string]string{
+		"hostname": hostname, "server": server,
+		"priority": strconv.Itoa(priority), "weight": strconv.Itoa(weight), "port": strconv.Itoa(port),
+	})
+}
+
+// AddTypeCAA creates a CAA record.
+func (c *Client) AddTypeCAA(ctx context.Context, zone, hostname string, flags int, tag, value string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneAddTypeCAA, map[string]string{
+		"hostname": hostname, "flags": strconv.Itoa(flags), "tag": tag, "value": value,
+	})
+}
+
+// DeleteTypeCAA deletes a CAA record.
+func (c *Client) DeleteTypeCAA(ctx context.Context, zone, hostname string, flags int, tag, value string) (*Response, error) {
+	return c.doWrite(ctx, zone, CommandZoneDeleteTypeCAA, map[string]string{
+		"hostname": hostname, "flags": strconv.Itoa(flags), "tag": tag, "value": value,
+	})
+}
+
+// doWrite issues a write command against zone. It does not itself serialize
+// concurrent writes to the same zone; callers that need that (because
+// Dinahosting has no way to apply a batch of changes atomically) must hold
+// LockZone for the duration of their batch.
+func (c *Client) doWrite(ctx context.Context, zone string, command Command, params map[string]string) (*Response, error) {
+	return c.do(ctx, zone, c.buildQuery(zone, command, params))
+}
+
+func (c *Client) buildQuery(zone string, command Command, extra map[string]string) *url.URL {
+	endpoint, _ := url.Parse(c.endpoint())
+
+	params := url.Values{}
+	params.Add("AUTH_USER", c.Username)
+	params.Add("AUTH_PWD", c.Password)
+	params.Add("domain", strings.TrimSuffix(zone, "."))
+	params.Add("responseType", "json")
+	params.Add("command", string(command))
+	for k, v := range extra {
+		params.Add(k, v)
+	}
+
+	endpoint.RawQuery = params.Encode()
+	return endpoint
+}
+
+// do executes the request against endpoint, retrying transient failures
+// (5xx responses and network errors) with exponential backoff and jitter.
+// A Retry-After response header, if present, takes precedence over the
+// computed backoff.
+func (c *Client) do(ctx context.Context, zone string, endpoint *url.URL) (*Response, error) {
+	var lastErr error
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retryDelay(attempt, lastErr)
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		response, retryAfter, err := c.doOnce(ctx, endpoint)
+		if err == nil {
+			if response.Message != "Success." {
+				return nil, &APIError{
+					ResponseCode: response.ResponseCode,
+					Message:      response.Message,
+					Command:      response.Command,
+					TrID:         response.TrID,
+				}
+			}
+			return response, nil
+		}
+		lastErr = err
+
+		var transient *transientError
+		if !errorsAsTransient(err, &transient) {
+			return nil, err
+		}
+		transient.retryAfter = retryAfter
+	}
+
+	return nil, fmt.Errorf("giving up on zone %s after %d attempts: %w", zone, maxRetries+1, lastErr)
+}
+
+// transientError marks an error as safe to retry, optionally carrying a
+// server-provided Retry-After duration.
+type transientError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+func errorsAsTransient(err error, target **transientError) bool {
+	te, ok := err.(*transientError)
+	if !ok {
+		return false
+	}
+	*target = te
+	return true
+}
+
+func retryDelay(attempt int, lastErr error) time.Duration {
+	if te, ok := lastErr.(*transientError); ok && te.retryAfter > 0 {
+		return te.retryAfter
+	}
+
+	delay := baseRetryDelay * time.Duration(1<<uint(attempt-1))
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// Full jitter: spreads out retries from concurrent callers hitting the
+	// same zone so they don't all wake up and retry at once.
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+func (c *Client) doOnce(ctx context.Context, endpoint *url.URL) (*Response, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, 0, &transientError{err: fmt.Errorf("request failed: %w", err)}
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode >= 500 {
+		return nil, retryAfterHeader(r), &transientError{err: fmt.Errorf("Dinahosting API returned HTTP %d", r.StatusCode)}
+	}
+
+	var response Response
+	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+		return nil, 0, fmt.Errorf("API response parsing failed: %w", err)
+	}
+
+	return &response, 0, nil
+}
+
+func retryAfterHeader(r *http.Response) time.Duration {
+	value := r.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return time.Until(when)
+	}
+	return 0
+}
@@ -4,84 +4,59 @@ package libdns_dinahosting
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 
+	"github.com/libdns/dinahosting/internal"
 	"github.com/libdns/libdns"
 )
 
-const (
-	endpointBase = "https://dinahosting.com/special/api.php"
-)
-
-type command string
-
-// API commands as per the spec
-const (
-	domain_Zone_GetAll        command = "Domain_Zone_GetAll"
-	domain_Zone_AddTypeA      command = "Domain_Zone_AddTypeA"
-	domain_Zone_DeleteTypeA   command = "Domain_Zone_DeleteTypeA"
-	domain_Zone_AddTypeTXT    command = "Domain_Zone_AddTypeTXT"
-	domain_Zone_DeleteTypeTXT command = "Domain_Zone_DeleteTypeTXT"
-)
-
 // Provider facilitates DNS record manipulation with Dinahosting.
 type Provider struct {
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
+
+	// HTTPClient, when set, is used to perform API requests instead of
+	// http.DefaultClient. This allows callers to plug in a custom
+	// transport, a proxy, or point the provider at a test server.
+	HTTPClient *http.Client
+
+	// baseURL overrides the Dinahosting API endpoint. Used by tests to
+	// point the provider at an httptest.Server instead of the live API.
+	baseURL string
+
+	clientOnce sync.Once
+	client     *internal.Client
 }
 
-// Struct for parsing API responses (not all fields will be used for any given response)
-type dinaResponse struct {
-	TrID         string `json:"trId,omitempty"`
-	ResponseCode int16  `json:"responseCode,omitempty"`
-	Message      string `json:"message,omitempty"`
-	Records      []struct {
-		RecordType          string `json:"type,omitempty"`
-		Hostname            string `json:"hostname,omitempty"`
-		DestinationHostname string `json:"destinationHostname,omitempty"`
-		Ip                  string `json:"ip,omitempty"`
-		Address             string `json:"address,omitempty"`
-		Text                string `json:"text,omitempty"`
-	} `json:"data,omitempty"`
-	Command string `json:"command,omitempty"`
+func (p *Provider) getClient() *internal.Client {
+	p.clientOnce.Do(func() {
+		p.client = internal.NewClient(p.Username, p.Password)
+		p.client.HTTPClient = p.HTTPClient
+		p.client.BaseURL = p.baseURL
+	})
+	return p.client
 }
 
 // GetRecords lists all the records in the zone.
 //
 // API docs: https://es.dinahosting.com/api/documentation
-//
-// Full endpoint: https://dinahosting.com/special/api.php?AUTH_USER=user&AUTH_PWD=pass&domain=example.com&responseType=json&command=Domain_Zone_GetAll
 func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	unlock := p.getClient().LockZone(zone)
+	defer unlock()
 
-	endpoint, err := p.buildQuery(zone, domain_Zone_GetAll)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
-	if err != nil {
-		return nil, err
-	}
+	return p.getRecords(ctx, zone)
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	r, err := client.Do(req)
+// getRecords is GetRecords without the zone lock, for callers (SetRecords)
+// that already hold it as part of a larger operation.
+func (p *Provider) getRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	response, err := p.getClient().ZoneGetAll(ctx, zone)
 	if err != nil {
-		return nil, err
-	}
-	defer r.Body.Close()
-
-	var response dinaResponse
-	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("API response parsing failed: %s", err)
-	}
-
-	if response.Message != "Success." {
-		return nil, fmt.Errorf("could retrieve records. Dinahosting API error code: %d", response.ResponseCode)
+		return nil, fmt.Errorf("could not retrieve records: %w", err)
 	}
 
 	var records []libdns.Record
@@ -89,20 +64,36 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 	// API response is not consistent with record value naming
 	for _, record := range response.Records {
 		var value string
-		if record.DestinationHostname != "" {
-			value = record.DestinationHostname
-		} else if record.Ip != "" {
-			value = record.Ip
-		} else if record.Address != "" {
-			value = record.Address
-		} else if record.Text != "" {
-			value = record.Text
+		var priority int
+
+		switch record.Type {
+		case "CNAME", "NS":
+			value = record.Destination
+		case "MX":
+			value = record.Server
+			priority = record.Priority
+		case "SRV":
+			value = fmt.Sprintf("%d %d %s", record.Weight, record.Port, record.Server)
+			priority = record.Priority
+		case "CAA":
+			value = fmt.Sprintf("%d %s %q", record.Flags, record.Tag, record.Value)
+		default:
+			if record.DestinationHostname != "" {
+				value = record.DestinationHostname
+			} else if record.Ip != "" {
+				value = record.Ip
+			} else if record.Address != "" {
+				value = record.Address
+			} else if record.Text != "" {
+				value = record.Text
+			}
 		}
 
 		records = append(records, libdns.Record{
-			Type:  record.RecordType,
-			Name:  record.Hostname,
-			Value: value,
+			Type:     record.Type,
+			Name:     record.Hostname,
+			Value:    value,
+			Priority: priority,
 		})
 	}
 	return records, nil
@@ -112,58 +103,26 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 //
 // API docs: https://es.dinahosting.com/api/documentation
 func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-
 	if len(records) == 0 {
 		return nil, fmt.Errorf("empty input Record list")
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	unlock := p.getClient().LockZone(zone)
+	defer unlock()
 
-	var response dinaResponse
+	return p.appendRecords(ctx, zone, records)
+}
+
+// appendRecords is AppendRecords without the zone lock, for callers
+// (SetRecords) that already hold it as part of a larger operation.
+func (p *Provider) appendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	var results []libdns.Record
 
-	// Each record type require a different command action as a param
 	for _, record := range records {
-		// Check if record type is supported/implemented
-		if record.Type != "TXT" && record.Type != "A" {
-			return nil, fmt.Errorf("creating %s records is not supported or not implemented yet", record.Type)
-		}
-
-		var endpoint *url.URL
-		var err error
-		// TXT record
-		if record.Type == "TXT" {
-			endpoint, err = p.buildQueryWithRecord(zone, domain_Zone_AddTypeTXT, record)
-			if err != nil {
-				return nil, err
-			}
-		} else if record.Type == "A" {
-			endpoint, err = p.buildQueryWithRecord(zone, domain_Zone_AddTypeA, record)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
-		if err != nil {
-			return nil, err
-		}
-
-		r, err := client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer r.Body.Close()
-
-		if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
-			return nil, fmt.Errorf("API response parsing failed: %s", err)
-		}
-
-		if response.Message == "Success." {
-			results = append(results, record)
-		} else {
-			return nil, fmt.Errorf("could not create %s record. Dinahosting API error code: %d", record.Type, response.ResponseCode)
+		if _, err := p.addRecord(ctx, zone, record); err != nil {
+			return nil, fmt.Errorf("could not create %s record: %w", record.Type, err)
 		}
+		results = append(results, record)
 	}
 
 	return results, nil
@@ -172,156 +131,215 @@ func (p *Provider) AppendRecords(ctx context.Context, zone string, records []lib
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
 // It returns the updated records.
 //
+// The whole read-decide-write cycle runs under the zone's lock, so a
+// concurrent SetRecords/AppendRecords/DeleteRecords call against the same
+// zone can't interleave with it and act on a stale view of the zone.
+//
 // API docs: https://es.dinahosting.com/api/documentation
 func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-
 	if len(records) == 0 {
 		return nil, fmt.Errorf("empty input Record list")
 	}
 
+	unlock := p.getClient().LockZone(zone)
+	defer unlock()
+
 	// Get all records for the zone, needed to check for existing records
-	existingRecords, err := p.GetRecords(ctx, zone)
+	existingRecords, err := p.getRecords(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
-	var toDelete []libdns.Record
-	var results []libdns.Record
-	for _, record := range records {
-		saved := 0
-		for _, existingRecord := range existingRecords {
-			// If record already exist we need to delete it and create it again with the new value
-			// as API does not have update
-			if saved == 0 {
-				if record.Name == existingRecord.Name && record.Type == existingRecord.Type && record.Value != existingRecord.Value {
-					toDelete = append(toDelete, existingRecord)
-					results = append(results, record)
-					saved = 1
-				} else if record.Name == existingRecord.Name && record.Type == existingRecord.Type && record.Value == existingRecord.Value {
-					break
-				} else {
-					results = append(results, record)
-					saved = 1
-				}
-			}
-		}
-	}
+
+	toDelete, toCreate := diffRecords(existingRecords, records)
 
 	if len(toDelete) > 0 {
-		if _, err := p.DeleteRecords(ctx, zone, toDelete); err != nil {
+		if _, err := p.deleteRecords(ctx, zone, toDelete); err != nil {
 			return nil, err
 		}
 	}
-	if _, err := p.AppendRecords(ctx, zone, results); err != nil {
-		return nil, err
+	if len(toCreate) > 0 {
+		if _, err := p.appendRecords(ctx, zone, toCreate); err != nil {
+			return nil, err
+		}
 	}
 
-	return results, nil
+	return records, nil
 }
 
-// DeleteRecords deletes the records from the zone. It returns the records that were deleted.
-//
-// API docs: https://es.dinahosting.com/api/documentation
-func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+// recordKey identifies the (Name, Type) bucket SetRecords reconciles. A
+// bucket is not unique to a single record: Dinahosting has no update API,
+// and MX, SRV, NS and round-robin A records routinely have several existing
+// records sharing a name and type.
+type recordKey struct {
+	name       string
+	recordType string
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+func keyOf(record libdns.Record) recordKey {
+	return recordKey{record.Name, record.Type}
+}
 
-	var response dinaResponse
-	var results []libdns.Record
+// diffRecords compares the zone's existing records against the desired set
+// and returns the existing records that must be deleted and the desired
+// records that must be created to reconcile the two. Only the (Name, Type)
+// buckets mentioned in desired are touched; existing records in other
+// buckets are left alone. Within a touched bucket, matching is done per
+// record rather than per key, so a bucket with several existing records
+// (e.g. two MX records) is reconciled one-to-one instead of collapsing to a
+// single slot: a desired record is left out of both slices only if an
+// existing record in the same bucket with the same Value and Priority
+// hasn't already been claimed by an earlier desired record.
+func diffRecords(existing, desired []libdns.Record) (toDelete, toCreate []libdns.Record) {
+	touchedKeys := make(map[recordKey]bool, len(desired))
+	for _, record := range desired {
+		touchedKeys[keyOf(record)] = true
+	}
 
-	for _, record := range records {
-		// Check if record type is supported/implemented
-		if record.Type != "TXT" && record.Type != "A" {
-			return nil, fmt.Errorf("deleting record type %s is not supported or not implemented yet", record.Type)
-		}
+	claimed := make([]bool, len(existing))
+
+	for _, record := range desired {
+		key := keyOf(record)
 
-		var endpoint *url.URL
-		var err error
-		// Delete TXT record
-		if record.Type == "TXT" {
-			endpoint, err = p.buildQueryWithRecord(zone, domain_Zone_DeleteTypeTXT, record)
-			if err != nil {
-				return nil, err
+		matched := -1
+		for i, current := range existing {
+			if claimed[i] || keyOf(current) != key {
+				continue
 			}
-			// Delete A record
-		} else if record.Type == "A" {
-			endpoint, err = p.buildQueryWithRecord(zone, domain_Zone_DeleteTypeA, record)
-			if err != nil {
-				return nil, err
+			if current.Value == record.Value && current.Priority == record.Priority {
+				matched = i
+				break
 			}
 		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
-		if err != nil {
-			return nil, err
+		if matched == -1 {
+			toCreate = append(toCreate, record)
+			continue
 		}
+		claimed[matched] = true
+	}
 
-		r, err := client.Do(req)
-		if err != nil {
-			return nil, err
+	for i, current := range existing {
+		if claimed[i] {
+			continue
 		}
-		defer r.Body.Close()
-
-		if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
-			return nil, fmt.Errorf("API response parsing failed: %s", err)
+		if touchedKeys[keyOf(current)] {
+			toDelete = append(toDelete, current)
 		}
+	}
+
+	return toDelete, toCreate
+}
+
+// DeleteRecords deletes the records from the zone. It returns the records that were deleted.
+//
+// API docs: https://es.dinahosting.com/api/documentation
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	unlock := p.getClient().LockZone(zone)
+	defer unlock()
+
+	return p.deleteRecords(ctx, zone, records)
+}
+
+// deleteRecords is DeleteRecords without the zone lock, for callers
+// (SetRecords) that already hold it as part of a larger operation.
+func (p *Provider) deleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	var results []libdns.Record
 
-		if response.Message == "Success." {
-			results = append(results, record)
-		} else {
-			return nil, fmt.Errorf("deletion of %s record failed, Dinahosting API error code: %d", record.Type, response.ResponseCode)
+	for _, record := range records {
+		if _, err := p.deleteRecord(ctx, zone, record); err != nil {
+			return nil, fmt.Errorf("could not delete %s record: %w", record.Type, err)
 		}
+		results = append(results, record)
 	}
 	return results, nil
 }
 
-// Build the api endpoint string with the default values, if Domain_Zone_GetAll
-// command is present, also include it.
-func (p *Provider) buildQuery(zone string, command command) (*url.URL, error) {
+// addRecord dispatches record to the internal.Client method for its type.
+func (p *Provider) addRecord(ctx context.Context, zone string, record libdns.Record) (*internal.Response, error) {
+	client := p.getClient()
 
-	endpoint, err := url.Parse(endpointBase)
+	zone, host, err := splitZoneAndHost(record.Name, zone)
 	if err != nil {
 		return nil, err
 	}
 
-	params := url.Values{}
-	params.Add("AUTH_USER", p.Username)
-	params.Add("AUTH_PWD", p.Password)
-	params.Add("domain", strings.TrimSuffix(zone, "."))
-	params.Add("responseType", "json")
-
-	if command == domain_Zone_GetAll {
-		params.Add("command", "Domain_Zone_GetAll")
+	switch record.Type {
+	case "A":
+		return client.AddTypeA(ctx, zone, host, record.Value)
+	case "AAAA":
+		return client.AddTypeAAAA(ctx, zone, host, record.Value)
+	case "TXT":
+		return client.AddTypeTXT(ctx, zone, host, record.Value)
+	case "CNAME":
+		return client.AddTypeCNAME(ctx, zone, host, record.Value)
+	case "NS":
+		return client.AddTypeNS(ctx, zone, host, record.Value)
+	case "MX":
+		return client.AddTypeMX(ctx, zone, host, record.Value, record.Priority)
+	case "SRV":
+		weight, port, target := splitSRVValue(record.Value)
+		return client.AddTypeSRV(ctx, zone, host, target, record.Priority, weight, port)
+	case "CAA":
+		flags, tag, value := splitCAAValue(record.Value)
+		return client.AddTypeCAA(ctx, zone, host, flags, tag, value)
+	default:
+		return nil, fmt.Errorf("creating %s records is not supported or not implemented yet", record.Type)
 	}
+}
 
-	endpoint.RawQuery = params.Encode()
-	return endpoint, nil
+// deleteRecord dispatches record to the internal.Client method for its type.
+func (p *Provider) deleteRecord(ctx context.Context, zone string, record libdns.Record) (*internal.Response, error) {
+	client := p.getClient()
 
-}
-func (p *Provider) buildQueryWithRecord(zone string, command command, record libdns.Record) (*url.URL, error) {
-	endpoint, err := p.buildQuery(zone, command)
+	zone, host, err := splitZoneAndHost(record.Name, zone)
 	if err != nil {
 		return nil, err
 	}
-	params := endpoint.Query()
-	if command == domain_Zone_AddTypeTXT {
-		params.Add("command", string(domain_Zone_AddTypeTXT))
-		params.Add("hostname", record.Name)
-		params.Add("text", record.Value)
-	} else if command == domain_Zone_AddTypeA {
-		params.Add("command", "Domain_Zone_AddTypeA")
-		params.Add("hostname", record.Name)
-		params.Add("ip", record.Value)
-	} else if command == domain_Zone_DeleteTypeTXT {
-		params.Add("command", "Domain_Zone_DeleteTypeTXT")
-		params.Add("hostname", record.Name)
-		params.Add("value", record.Value)
-	} else if command == domain_Zone_DeleteTypeA {
-		params.Add("command", "Domain_Zone_DeleteTypeA")
-		params.Add("hostname", record.Name)
-		params.Add("ip", record.Value)
+
+	switch record.Type {
+	case "A":
+		return client.DeleteTypeA(ctx, zone, host, record.Value)
+	case "AAAA":
+		return client.DeleteTypeAAAA(ctx, zone, host, record.Value)
+	case "TXT":
+		return client.DeleteTypeTXT(ctx, zone, host, record.Value)
+	case "CNAME":
+		return client.DeleteTypeCNAME(ctx, zone, host, record.Value)
+	case "NS":
+		return client.DeleteTypeNS(ctx, zone, host, record.Value)
+	case "MX":
+		return client.DeleteTypeMX(ctx, zone, host, record.Value, record.Priority)
+	case "SRV":
+		weight, port, target := splitSRVValue(record.Value)
+		return client.DeleteTypeSRV(ctx, zone, host, target, record.Priority, weight, port)
+	case "CAA":
+		flags, tag, value := splitCAAValue(record.Value)
+		return client.DeleteTypeCAA(ctx, zone, host, flags, tag, value)
+	default:
+		return nil, fmt.Errorf("deleting record type %s is not supported or not implemented yet", record.Type)
+	}
+}
+
+// splitSRVValue splits the weight/port/target packed into record.Value by
+// GetRecords back into its three components.
+func splitSRVValue(value string) (weight, port int, target string) {
+	parts := strings.SplitN(value, " ", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	weight, _ = strconv.Atoi(parts[0])
+	port, _ = strconv.Atoi(parts[1])
+	return weight, port, parts[2]
+}
+
+// splitCAAValue splits the flags/tag/value packed into record.Value by
+// GetRecords back into its three components.
+func splitCAAValue(value string) (flags int, tag, caaValue string) {
+	parts := strings.SplitN(value, " ", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
 	}
-	endpoint.RawQuery = params.Encode()
-	return endpoint, nil
+	flags, _ = strconv.Atoi(parts[0])
+	return flags, parts[1], strings.Trim(parts[2], `"`)
 }
 
 // Interface guards
@@ -1,435 +1,279 @@
 // Package dinahosting implements a DNS record management client compatible
 // with the libdns interfaces for Dinahosting (https://es.dinahosting.com/api).
-package dinahosting
+package libdns_dinahosting
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 
+	"github.com/libdns/dinahosting/internal"
 	"github.com/libdns/libdns"
 )
 
-// To be able to run the tests succesfully please replace this constants with you actual account details.
-//
-// This tests assumes you have a test zone with only 1 A type record
-// they will create, modify and delete some records on that zone
-// but it should be at the original state afer finishing runinng.
-const (
-	username = "YOUR_USERNAME"
-	password = "YOUR_PASSWORD"
-	zone     = "example.com"
-	ip       = "YOUR A RECORD IP"
-)
+// newTestProvider returns a Provider pointed at an httptest.Server that
+// serves handler's responses instead of the live Dinahosting API.
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *Provider {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &Provider{
+		Username: "test-user",
+		Password: "test-pass",
+		baseURL:  server.URL,
+	}
+}
+
+func jsonResponse(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, body)
+}
 
-// This test assumes your test zone only has 1 A record.
-// Please modify record.Value with your actual IP value.
 func TestProvider_GetRecords(t *testing.T) {
-	type fields struct {
-		Username string
-		Password string
+	var gotQuery url.Values
+
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		jsonResponse(w, `{
+			"trId": "1",
+			"responseCode": 200,
+			"message": "Success.",
+			"command": "Domain_Zone_GetAll",
+			"data": [
+				{"type": "A", "hostname": "@", "ip": "1.1.1.1"},
+				{"type": "TXT", "hostname": "test", "text": "hello"},
+				{"type": "MX", "hostname": "@", "server": "mail.example.com", "priority": 10},
+				{"type": "SRV", "hostname": "_sip._tcp", "server": "sip.example.com", "priority": 10, "weight": 20, "port": 5060},
+				{"type": "CAA", "hostname": "@", "flags": 0, "tag": "issue", "value": "letsencrypt.org"}
+			]
+		}`)
+	})
+
+	got, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Provider.GetRecords() error = %v", err)
 	}
-	type args struct {
-		ctx  context.Context
-		zone string
+
+	want := []libdns.Record{
+		{Type: "A", Name: "@", Value: "1.1.1.1"},
+		{Type: "TXT", Name: "test", Value: "hello"},
+		{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 10},
+		{Type: "SRV", Name: "_sip._tcp", Value: "20 5060 sip.example.com", Priority: 10},
+		{Type: "CAA", Name: "@", Value: `0 issue "letsencrypt.org"`},
 	}
-	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    []libdns.Record
-		wantErr bool
-	}{
-		{
-			name: "Test A record exists",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-			},
-			want: []libdns.Record{
-				{
-					ID:       "",
-					Type:     "A",
-					Name:     "@",
-					Value:    ip,
-					TTL:      0,
-					Priority: 0,
-				},
-			},
-			wantErr: false,
-		},
-		{
-			name: "Test auth error",
-			fields: fields{
-				Username: "wrongUser",
-				Password: "wrongPass",
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-			},
-			want:    nil,
-			wantErr: true,
-		},
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Provider.GetRecords() = %+v, want %+v", got, want)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			p := &Provider{
-				Username: tt.fields.Username,
-				Password: tt.fields.Password,
-			}
-			got, err := p.GetRecords(tt.args.ctx, tt.args.zone)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Provider.GetRecords() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Provider.GetRecords() = %v, want %v", got, tt.want)
-			}
-		})
+
+	if cmd := gotQuery.Get("command"); cmd != "Domain_Zone_GetAll" {
+		t.Errorf("command = %q, want Domain_Zone_GetAll", cmd)
+	}
+	if domain := gotQuery.Get("domain"); domain != "example.com" {
+		t.Errorf("domain = %q, want example.com", domain)
+	}
+	if gotQuery.Get("AUTH_USER") != "test-user" || gotQuery.Get("AUTH_PWD") != "test-pass" {
+		t.Errorf("unexpected auth params: %v", gotQuery)
 	}
 }
 
-func TestProvider_AppendRecords(t *testing.T) {
-	type fields struct {
-		Username string
-		Password string
+func TestProvider_GetRecords_error(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, `{"responseCode": 1020, "message": "Authentication error.", "command": "Domain_Zone_GetAll"}`)
+	})
+
+	_, err := p.GetRecords(context.Background(), "example.com")
+	if err == nil {
+		t.Fatal("Provider.GetRecords() expected an error")
 	}
-	type args struct {
-		ctx     context.Context
-		zone    string
-		records []libdns.Record
+
+	var apiErr *internal.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Provider.GetRecords() error = %v, want an *internal.APIError", err)
+	}
+	if apiErr.ResponseCode != 1020 {
+		t.Errorf("APIError.ResponseCode = %d, want 1020", apiErr.ResponseCode)
 	}
+}
+
+func TestProvider_AppendRecords(t *testing.T) {
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    []libdns.Record
-		wantErr bool
+		name        string
+		record      libdns.Record
+		wantCommand string
+		wantParams  map[string]string
 	}{
 		{
-			name: "Test create A record",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-				records: []libdns.Record{
-					{
-						ID:       "",
-						Type:     "A",
-						Name:     "test",
-						Value:    "1.1.1.1",
-						TTL:      0,
-						Priority: 0,
-					},
-				},
-			},
-			want: []libdns.Record{
-				{
-					ID:       "",
-					Type:     "A",
-					Name:     "test",
-					Value:    "1.1.1.1",
-					TTL:      0,
-					Priority: 0,
-				},
-			},
-			wantErr: false,
+			name:        "A record",
+			record:      libdns.Record{Type: "A", Name: "test", Value: "1.1.1.1"},
+			wantCommand: "Domain_Zone_AddTypeA",
+			wantParams:  map[string]string{"hostname": "test", "ip": "1.1.1.1"},
+		},
+		{
+			name:        "TXT record",
+			record:      libdns.Record{Type: "TXT", Name: "test", Value: "hello"},
+			wantCommand: "Domain_Zone_AddTypeTXT",
+			wantParams:  map[string]string{"hostname": "test", "text": "hello"},
+		},
+		{
+			name:        "MX record",
+			record:      libdns.Record{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 10},
+			wantCommand: "Domain_Zone_AddTypeMX",
+			wantParams:  map[string]string{"hostname": "@", "server": "mail.example.com", "priority": "10"},
 		},
 		{
-			name: "Test error when same A record exists",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-				records: []libdns.Record{
-					{
-						ID:       "",
-						Type:     "A",
-						Name:     "test",
-						Value:    "1.1.1.1",
-						TTL:      0,
-						Priority: 0,
-					},
-				},
-			},
-			want:    nil,
-			wantErr: true,
+			name:        "SRV record",
+			record:      libdns.Record{Type: "SRV", Name: "_sip._tcp", Value: "20 5060 sip.example.com", Priority: 10},
+			wantCommand: "Domain_Zone_AddTypeSRV",
+			wantParams:  map[string]string{"hostname": "_sip._tcp", "server": "sip.example.com", "priority": "10", "weight": "20", "port": "5060"},
 		},
 		{
-			name: "Test create TXT record",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-				records: []libdns.Record{
-					{
-						ID:       "",
-						Type:     "TXT",
-						Name:     "test",
-						Value:    "2.2.2.2",
-						TTL:      0,
-						Priority: 0,
-					},
-				},
-			},
-			want: []libdns.Record{
-				{
-					ID:       "",
-					Type:     "TXT",
-					Name:     "test",
-					Value:    "2.2.2.2",
-					TTL:      0,
-					Priority: 0,
-				},
-			},
-			wantErr: false,
+			name:        "CAA record",
+			record:      libdns.Record{Type: "CAA", Name: "@", Value: `0 issue "letsencrypt.org"`},
+			wantCommand: "Domain_Zone_AddTypeCAA",
+			wantParams:  map[string]string{"hostname": "@", "flags": "0", "tag": "issue", "value": "letsencrypt.org"},
 		},
 	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &Provider{
-				Username: tt.fields.Username,
-				Password: tt.fields.Password,
+			var gotQuery url.Values
+			p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.Query()
+				jsonResponse(w, fmt.Sprintf(`{"responseCode": 200, "message": "Success.", "command": %q}`, tt.wantCommand))
+			})
+
+			got, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{tt.record})
+			if err != nil {
+				t.Fatalf("Provider.AppendRecords() error = %v", err)
 			}
-			got, err := p.AppendRecords(tt.args.ctx, tt.args.zone, tt.args.records)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Provider.AppendRecords() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			if want := []libdns.Record{tt.record}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Provider.AppendRecords() = %+v, want %+v", got, want)
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Provider.AppendRecords() = %v, want %v", got, tt.want)
+
+			if cmd := gotQuery.Get("command"); cmd != tt.wantCommand {
+				t.Errorf("command = %q, want %q", cmd, tt.wantCommand)
+			}
+			for k, v := range tt.wantParams {
+				if got := gotQuery.Get(k); got != v {
+					t.Errorf("param %q = %q, want %q", k, got, v)
+				}
 			}
 		})
 	}
 }
 
-func TestProvider_SetRecords(t *testing.T) {
-	type fields struct {
-		Username string
-		Password string
+func TestProvider_AppendRecords_error(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, `{"responseCode": 1021, "message": "Record already exists.", "command": "Domain_Zone_AddTypeA"}`)
+	})
+
+	_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		{Type: "A", Name: "test", Value: "1.1.1.1"},
+	})
+	if err == nil {
+		t.Fatal("Provider.AppendRecords() expected an error")
 	}
-	type args struct {
-		ctx     context.Context
-		zone    string
-		records []libdns.Record
+
+	var apiErr *internal.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Provider.AppendRecords() error = %v, want an *internal.APIError", err)
+	}
+	if apiErr.ResponseCode != 1021 {
+		t.Errorf("APIError.ResponseCode = %d, want 1021", apiErr.ResponseCode)
 	}
+}
+
+func TestProvider_DeleteRecords(t *testing.T) {
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    []libdns.Record
-		wantErr bool
+		name        string
+		record      libdns.Record
+		wantCommand string
+		wantParams  map[string]string
 	}{
 		{
-			name: "Test update A record",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-				records: []libdns.Record{
-					{
-						ID:       "",
-						Type:     "A",
-						Name:     "test",
-						Value:    "2.2.2.2",
-						TTL:      0,
-						Priority: 0,
-					},
-				},
-			},
-			want: []libdns.Record{
-				{
-					ID:       "",
-					Type:     "A",
-					Name:     "test",
-					Value:    "2.2.2.2",
-					TTL:      0,
-					Priority: 0,
-				},
-			},
-			wantErr: false,
+			name:        "A record",
+			record:      libdns.Record{Type: "A", Name: "test", Value: "1.1.1.1"},
+			wantCommand: "Domain_Zone_DeleteTypeA",
+			wantParams:  map[string]string{"hostname": "test", "ip": "1.1.1.1"},
+		},
+		{
+			name:        "TXT record",
+			record:      libdns.Record{Type: "TXT", Name: "test", Value: "hello"},
+			wantCommand: "Domain_Zone_DeleteTypeTXT",
+			wantParams:  map[string]string{"hostname": "test", "value": "hello"},
+		},
+		{
+			name:        "MX record",
+			record:      libdns.Record{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 10},
+			wantCommand: "Domain_Zone_DeleteTypeMX",
+			wantParams:  map[string]string{"hostname": "@", "server": "mail.example.com", "priority": "10"},
 		},
 		{
-			name: "Test create TXT record",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-				records: []libdns.Record{
-					{
-						ID:       "",
-						Type:     "TXT",
-						Name:     "test",
-						Value:    "3.3.3.3",
-						TTL:      0,
-						Priority: 0,
-					},
-				},
-			},
-			want: []libdns.Record{
-				{
-					ID:       "",
-					Type:     "TXT",
-					Name:     "test",
-					Value:    "3.3.3.3",
-					TTL:      0,
-					Priority: 0,
-				},
-			},
-			wantErr: false,
+			name:        "SRV record",
+			record:      libdns.Record{Type: "SRV", Name: "_sip._tcp", Value: "20 5060 sip.example.com", Priority: 10},
+			wantCommand: "Domain_Zone_DeleteTypeSRV",
+			wantParams:  map[string]string{"hostname": "_sip._tcp", "server": "sip.example.com", "priority": "10", "weight": "20", "port": "5060"},
+		},
+		{
+			name:        "CAA record",
+			record:      libdns.Record{Type: "CAA", Name: "@", Value: `0 issue "letsencrypt.org"`},
+			wantCommand: "Domain_Zone_DeleteTypeCAA",
+			wantParams:  map[string]string{"hostname": "@", "flags": "0", "tag": "issue", "value": "letsencrypt.org"},
 		},
 	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &Provider{
-				Username: tt.fields.Username,
-				Password: tt.fields.Password,
+			var gotQuery url.Values
+			p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.Query()
+				jsonResponse(w, fmt.Sprintf(`{"responseCode": 200, "message": "Success.", "command": %q}`, tt.wantCommand))
+			})
+
+			got, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{tt.record})
+			if err != nil {
+				t.Fatalf("Provider.DeleteRecords() error = %v", err)
 			}
-			got, err := p.SetRecords(tt.args.ctx, tt.args.zone, tt.args.records)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Provider.SetRecords() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			if want := []libdns.Record{tt.record}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Provider.DeleteRecords() = %+v, want %+v", got, want)
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Provider.SetRecords() = %v, want %v", got, tt.want)
+
+			if cmd := gotQuery.Get("command"); cmd != tt.wantCommand {
+				t.Errorf("command = %q, want %q", cmd, tt.wantCommand)
+			}
+			for k, v := range tt.wantParams {
+				if got := gotQuery.Get(k); got != v {
+					t.Errorf("param %q = %q, want %q", k, got, v)
+				}
 			}
 		})
 	}
 }
 
-func TestProvider_DeleteRecords(t *testing.T) {
+func TestProvider_DeleteRecords_error(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, `{"responseCode": 1022, "message": "Record not found.", "command": "Domain_Zone_DeleteTypeA"}`)
+	})
 
-	type fields struct {
-		Username string
-		Password string
+	_, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		{Type: "A", Name: "test", Value: "1.1.1.1"},
+	})
+	if err == nil {
+		t.Fatal("Provider.DeleteRecords() expected an error")
 	}
-	type args struct {
-		ctx     context.Context
-		zone    string
-		records []libdns.Record
-	}
-	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    []libdns.Record
-		wantErr bool
-	}{
-		{
-			name: "Test deletion of A record",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-				records: []libdns.Record{
-					{
-						ID:       "",
-						Type:     "A",
-						Name:     "test",
-						Value:    "2.2.2.2",
-						TTL:      0,
-						Priority: 0,
-					},
-				},
-			},
-			want: []libdns.Record{
-				{
-					ID:       "",
-					Type:     "A",
-					Name:     "test",
-					Value:    "2.2.2.2",
-					TTL:      0,
-					Priority: 0,
-				},
-			},
-			wantErr: false,
-		},
-		{
-			name: "Test deletion of TXT record",
-			fields: fields{
-				Username: username,
-				Password: password,
-			},
-			args: args{
-				ctx:  context.Background(),
-				zone: zone,
-				records: []libdns.Record{
-					{
-						ID:       "",
-						Type:     "TXT",
-						Name:     "test",
-						Value:    "2.2.2.2",
-						TTL:      0,
-						Priority: 0,
-					},
-					{
-						ID:       "",
-						Type:     "TXT",
-						Name:     "test",
-						Value:    "3.3.3.3",
-						TTL:      0,
-						Priority: 0,
-					},
-				},
-			},
-			want: []libdns.Record{
-				{
-					ID:       "",
-					Type:     "TXT",
-					Name:     "test",
-					Value:    "2.2.2.2",
-					TTL:      0,
-					Priority: 0,
-				},
-				{
-					ID:       "",
-					Type:     "TXT",
-					Name:     "test",
-					Value:    "3.3.3.3",
-					TTL:      0,
-					Priority: 0,
-				},
-			},
-			wantErr: false,
-		},
+
+	var apiErr *internal.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Provider.DeleteRecords() error = %v, want an *internal.APIError", err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			p := &Provider{
-				Username: tt.fields.Username,
-				Password: tt.fields.Password,
-			}
-			got, err := p.DeleteRecords(tt.args.ctx, tt.args.zone, tt.args.records)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Provider.DeleteRecords() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Provider.DeleteRecords() = %v, want %v", got, tt.want)
-			}
-		})
+	if apiErr.ResponseCode != 1022 {
+		t.Errorf("APIError.ResponseCode = %d, want 1022", apiErr.ResponseCode)
 	}
 }
@@ -0,0 +1,73 @@
+package libdns_dinahosting
+
+import "testing"
+
+func TestSplitSRVValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		wantWeight int
+		wantPort   int
+		wantTarget string
+	}{
+		{
+			name:       "well-formed value",
+			value:      "10 5060 sip.example.com",
+			wantWeight: 10,
+			wantPort:   5060,
+			wantTarget: "sip.example.com",
+		},
+		{
+			name:       "missing target",
+			value:      "10 5060",
+			wantWeight: 10,
+			wantPort:   5060,
+			wantTarget: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weight, port, target := splitSRVValue(tt.value)
+			if weight != tt.wantWeight || port != tt.wantPort || target != tt.wantTarget {
+				t.Errorf("splitSRVValue(%q) = (%d, %d, %q), want (%d, %d, %q)",
+					tt.value, weight, port, target, tt.wantWeight, tt.wantPort, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestSplitCAAValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantFlags int
+		wantTag   string
+		wantValue string
+	}{
+		{
+			name:      "well-formed value",
+			value:     `0 issue "letsencrypt.org"`,
+			wantFlags: 0,
+			wantTag:   "issue",
+			wantValue: "letsencrypt.org",
+		},
+		{
+			name:      "unquoted value",
+			value:     "128 issuewild letsencrypt.org",
+			wantFlags: 128,
+			wantTag:   "issuewild",
+			wantValue: "letsencrypt.org",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, tag, value := splitCAAValue(tt.value)
+			if flags != tt.wantFlags || tag != tt.wantTag || value != tt.wantValue {
+				t.Errorf("splitCAAValue(%q) = (%d, %q, %q), want (%d, %q, %q)",
+					tt.value, flags, tag, value, tt.wantFlags, tt.wantTag, tt.wantValue)
+			}
+		})
+	}
+}
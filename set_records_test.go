@@ -0,0 +1,124 @@
+package libdns_dinahosting
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+func TestDiffRecords(t *testing.T) {
+	tests := []struct {
+		name         string
+		existing     []libdns.Record
+		desired      []libdns.Record
+		wantToDelete []libdns.Record
+		wantToCreate []libdns.Record
+	}{
+		{
+			name: "no-op when identical record exists",
+			existing: []libdns.Record{
+				{Type: "A", Name: "@", Value: "1.1.1.1"},
+				{Type: "TXT", Name: "test", Value: "old-value"},
+			},
+			desired: []libdns.Record{
+				{Type: "A", Name: "@", Value: "1.1.1.1"},
+			},
+			wantToDelete: nil,
+			wantToCreate: nil,
+		},
+		{
+			name: "update when value differs",
+			existing: []libdns.Record{
+				{Type: "A", Name: "@", Value: "1.1.1.1"},
+				{Type: "TXT", Name: "test", Value: "old-value"},
+			},
+			desired: []libdns.Record{
+				{Type: "TXT", Name: "test", Value: "new-value"},
+			},
+			wantToDelete: []libdns.Record{
+				{Type: "TXT", Name: "test", Value: "old-value"},
+			},
+			wantToCreate: []libdns.Record{
+				{Type: "TXT", Name: "test", Value: "new-value"},
+			},
+		},
+		{
+			name: "create when absent",
+			existing: []libdns.Record{
+				{Type: "A", Name: "@", Value: "1.1.1.1"},
+				{Type: "TXT", Name: "test", Value: "old-value"},
+			},
+			desired: []libdns.Record{
+				{Type: "CNAME", Name: "www", Value: "example.com"},
+			},
+			wantToDelete: nil,
+			wantToCreate: []libdns.Record{
+				{Type: "CNAME", Name: "www", Value: "example.com"},
+			},
+		},
+		{
+			name: "mixed inputs",
+			existing: []libdns.Record{
+				{Type: "A", Name: "@", Value: "1.1.1.1"},
+				{Type: "TXT", Name: "test", Value: "old-value"},
+			},
+			desired: []libdns.Record{
+				{Type: "A", Name: "@", Value: "1.1.1.1"},           // no-op
+				{Type: "TXT", Name: "test", Value: "new-value"},    // update
+				{Type: "CNAME", Name: "www", Value: "example.com"}, // create
+			},
+			wantToDelete: []libdns.Record{
+				{Type: "TXT", Name: "test", Value: "old-value"},
+			},
+			wantToCreate: []libdns.Record{
+				{Type: "TXT", Name: "test", Value: "new-value"},
+				{Type: "CNAME", Name: "www", Value: "example.com"},
+			},
+		},
+		{
+			// A (Name, Type) pair is not unique: MX, SRV, NS and round-robin
+			// A records routinely have several existing records side by
+			// side. A no-op SetRecords call must leave all of them alone,
+			// not collapse the bucket down to a single entry.
+			name: "no-op when multiple existing records share a name and type",
+			existing: []libdns.Record{
+				{Type: "MX", Name: "@", Value: "mail1.example.com", Priority: 10},
+				{Type: "MX", Name: "@", Value: "mail2.example.com", Priority: 20},
+			},
+			desired: []libdns.Record{
+				{Type: "MX", Name: "@", Value: "mail1.example.com", Priority: 10},
+				{Type: "MX", Name: "@", Value: "mail2.example.com", Priority: 20},
+			},
+			wantToDelete: nil,
+			wantToCreate: nil,
+		},
+		{
+			name: "update when only priority differs",
+			existing: []libdns.Record{
+				{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 10},
+			},
+			desired: []libdns.Record{
+				{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 20},
+			},
+			wantToDelete: []libdns.Record{
+				{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 10},
+			},
+			wantToCreate: []libdns.Record{
+				{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 20},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toDelete, toCreate := diffRecords(tt.existing, tt.desired)
+			if !reflect.DeepEqual(toDelete, tt.wantToDelete) {
+				t.Errorf("diffRecords() toDelete = %v, want %v", toDelete, tt.wantToDelete)
+			}
+			if !reflect.DeepEqual(toCreate, tt.wantToCreate) {
+				t.Errorf("diffRecords() toCreate = %v, want %v", toCreate, tt.wantToCreate)
+			}
+		})
+	}
+}
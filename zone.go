@@ -0,0 +1,71 @@
+package libdns_dinahosting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// splitZoneAndHost resolves the relative host Dinahosting expects for name
+// within zone. name may be given relative to zone (the usual libdns
+// convention) or as a fully-qualified domain name (e.g.
+// "_acme-challenge.sub.example.com"); both forms, with or without a
+// trailing dot, are normalized to the same result. The apex of the zone is
+// reported as "@", matching what the Dinahosting API returns from
+// Domain_Zone_GetAll.
+func splitZoneAndHost(name, zone string) (normalizedZone, host string, err error) {
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" {
+		return "", "", fmt.Errorf("zone must not be empty")
+	}
+
+	// Dinahosting itself reports the zone apex as "@" (see GetRecords), so
+	// round-tripping a record it handed us must recognize that alias too.
+	if name == "@" {
+		name = ""
+	}
+
+	// libdns.AbsoluteName does not detect that name is already a fully
+	// qualified domain name; it unconditionally appends zone whenever name
+	// isn't empty, which would double up a caller-supplied FQDN (e.g.
+	// "_acme-challenge.sub.example.com") and, worse, can make an
+	// out-of-zone name like "test.example.org." falsely appear to share
+	// zone's registrable domain once "example.com" is concatenated onto
+	// it. Detect an already-absolute name ourselves and skip the call
+	// entirely rather than risk it being silently concatenated.
+	trimmedName := strings.TrimSuffix(name, ".")
+	var fqdn string
+	switch {
+	case strings.HasSuffix(name, "."):
+		// A trailing dot is an unambiguous FQDN marker.
+		fqdn = trimmedName
+	case trimmedName == zone || strings.HasSuffix(trimmedName, "."+zone):
+		// No trailing dot, but name is still already absolute with regard
+		// to zone (some callers omit the final dot).
+		fqdn = trimmedName
+	default:
+		fqdn = strings.TrimSuffix(libdns.AbsoluteName(name, zone), ".")
+	}
+
+	zoneSuffix, err := publicsuffix.EffectiveTLDPlusOne(zone)
+	if err != nil {
+		return "", "", fmt.Errorf("could not determine registrable domain for zone %q: %w", zone, err)
+	}
+	fqdnSuffix, err := publicsuffix.EffectiveTLDPlusOne(fqdn)
+	if err != nil {
+		return "", "", fmt.Errorf("could not determine registrable domain for %q: %w", name, err)
+	}
+	if fqdnSuffix != zoneSuffix {
+		return "", "", fmt.Errorf("%q does not belong to the registrable domain of zone %q", name, zone)
+	}
+
+	host = strings.TrimSuffix(fqdn, zone)
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		host = "@"
+	}
+
+	return zone, host, nil
+}
@@ -0,0 +1,92 @@
+package libdns_dinahosting
+
+import "testing"
+
+func TestSplitZoneAndHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		fqdn     string
+		zone     string
+		wantHost string
+		wantErr  bool
+	}{
+		{
+			name:     "relative apex",
+			fqdn:     "@",
+			zone:     "example.com",
+			wantHost: "@",
+		},
+		{
+			name:     "absolute apex",
+			fqdn:     "example.com.",
+			zone:     "example.com",
+			wantHost: "@",
+		},
+		{
+			name:     "absolute apex, zone with trailing dot",
+			fqdn:     "example.com.",
+			zone:     "example.com.",
+			wantHost: "@",
+		},
+		{
+			name:     "relative single label",
+			fqdn:     "test",
+			zone:     "example.com",
+			wantHost: "test",
+		},
+		{
+			name:     "absolute single label",
+			fqdn:     "test.example.com.",
+			zone:     "example.com",
+			wantHost: "test",
+		},
+		{
+			name:     "relative multi-label subdomain",
+			fqdn:     "_acme-challenge.sub",
+			zone:     "example.com",
+			wantHost: "_acme-challenge.sub",
+		},
+		{
+			name:     "absolute multi-label subdomain",
+			fqdn:     "_acme-challenge.sub.example.com.",
+			zone:     "example.com",
+			wantHost: "_acme-challenge.sub",
+		},
+		{
+			name:     "absolute multi-label subdomain, zone with trailing dot",
+			fqdn:     "_acme-challenge.sub.example.com.",
+			zone:     "example.com.",
+			wantHost: "_acme-challenge.sub",
+		},
+		{
+			name:    "absolute fqdn outside the zone",
+			fqdn:    "test.example.org.",
+			zone:    "example.com",
+			wantErr: true,
+		},
+		{
+			name:    "empty zone",
+			fqdn:    "test",
+			zone:    "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone, host, err := splitZoneAndHost(tt.fqdn, tt.zone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitZoneAndHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if host != tt.wantHost {
+				t.Errorf("splitZoneAndHost() host = %q, want %q", host, tt.wantHost)
+			}
+			if zone == "" {
+				t.Errorf("splitZoneAndHost() returned empty zone")
+			}
+		})
+	}
+}